@@ -0,0 +1,129 @@
+// Package containertest provides a generic container fixture for tests
+// that need some service (a database, a cache, a broker, ...) running in
+// a container, parameterized by image, environment variables, exposed
+// ports and a readiness probe.
+//
+// pgtest, mysqltest and redistest are thin wrappers built on top of it;
+// New can equally be used directly for images that don't have one.
+package containertest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/minutelab/go-mlabtest"
+)
+
+// defaultStartTimeout is the start timeout New uses when
+// Config.StartTimeout is zero.
+const defaultStartTimeout = 30 * time.Second
+
+// Config describes the container to launch.
+type Config struct {
+	// Image is the image reference to run (pulled if not present locally)
+	Image string
+	// Env holds "KEY=value" environment variables passed to the container
+	Env []string
+	// ExposedPorts lists the container ports that should be published to
+	// random host ports, reachable later through GetAddressPort
+	ExposedPorts []int
+	// ReadyFunc, if set, builds the readiness probe used to decide when
+	// the container is actually ready to serve requests, see
+	// mlabtest.MLab.ReadyFunc. It is called once, after the container is
+	// created but before it is started.
+	ReadyFunc func(c *Container) mlabtest.ReadyFunc
+	// StartTimeout is the deadline for ReadyFunc to succeed, counted from
+	// before the image is pulled, so pulling and starting the container
+	// use up part of it. Zero means use defaultStartTimeout.
+	StartTimeout time.Duration
+}
+
+// Container is a running container fixture started from an arbitrary image
+type Container struct {
+	lab *mlabtest.MLab
+}
+
+// New creates a new Container from the given Config.
+//
+// if tb is not null the Container object is related to this testing
+// object: logs will be sent to it, and New either succeeds or fails the
+// test with Fatal, so errors don't need to be tested.
+//
+// log is optional function to log stderr/stdout, can be nil and then
+// defaults are used (either tb.Log or stdout)
+func New(tb testing.TB, cfg Config, log func(string)) (*Container, error) {
+	c, err := newContainer(tb, cfg, log)
+	if err != nil && tb != nil {
+		tb.Fatal("Error starting container: ", err)
+	}
+	return c, err
+}
+
+func newContainer(tb testing.TB, cfg Config, log func(string)) (*Container, error) {
+	lab, err := mlabtest.NewDocker(tb, mlabtest.DockerImageConfig{
+		Image:        cfg.Image,
+		Env:          cfg.Env,
+		ExposedPorts: cfg.ExposedPorts,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	success := false
+	defer func() {
+		if !success {
+			lab.Close()
+		}
+	}()
+
+	lab.Stdout = mlabtest.NewLineLogger(mlabtest.DefaultLogger(tb, cfg.Image+": ", log))
+	lab.Stderr = lab.Stdout
+
+	c := &Container{lab: lab}
+	if cfg.ReadyFunc != nil {
+		lab.ReadyFunc = cfg.ReadyFunc(c)
+	}
+
+	timeout := cfg.StartTimeout
+	if timeout <= 0 {
+		timeout = defaultStartTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := lab.StartContext(ctx); err != nil {
+		return nil, err
+	}
+
+	success = true
+	return c, nil
+}
+
+// Log a string
+func (c *Container) Log(format string, a ...interface{}) { c.lab.Log(format, a...) }
+
+// Close the container
+func (c *Container) Close() error {
+	c.Log("Container:Close")
+	return c.lab.Close()
+}
+
+// GetAddressPort return the address and port used to access the specified container port
+func (c *Container) GetAddressPort(port int) (net.IP, int, error) {
+	return c.lab.GetAddressPort(port)
+}
+
+// IP return the internal IP address of the container
+func (c *Container) IP() (net.IP, error) {
+	conf, err := c.lab.NetConfig()
+	if err != nil {
+		return nil, err
+	}
+	if ip := conf.IP(); ip != nil {
+		return ip, nil
+	}
+	return nil, fmt.Errorf("no IP for container")
+}
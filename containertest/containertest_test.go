@@ -0,0 +1,52 @@
+package containertest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/minutelab/go-mlabtest"
+)
+
+func TestContainer(t *testing.T) {
+	cfg := Config{
+		Image:        "docker:dind",
+		ExposedPorts: []int{2375},
+		ReadyFunc:    ready,
+	}
+
+	c, _ := New(t, cfg, nil)
+	defer c.Close()
+
+	ip, port, err := c.GetAddressPort(2375)
+	if err != nil {
+		t.Fatal("failed getting address:port:", err)
+	}
+	t.Log("Container reachable at", ip, port)
+}
+
+func ready(c *Container) mlabtest.ReadyFunc {
+	return func(ctx context.Context) error {
+		ip, port, err := c.GetAddressPort(2375)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d/_ping", ip.String(), port), nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("ping returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,230 @@
+package mlabtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+)
+
+// DockerImageConfig describes how to launch a container directly through
+// the Docker Engine, bypassing the `mlab` CLI entirely.
+type DockerImageConfig struct {
+	// Image is the image reference to run (pulled if not present locally)
+	Image string
+	// Env holds "KEY=value" environment variables passed to the container
+	Env []string
+	// Cmd overrides the image's default command, if set
+	Cmd []string
+	// ExposedPorts lists the container ports that should be published to
+	// random host ports, so they can later be reached through GetAddressPort
+	ExposedPorts []int
+	// Binds mounts host paths into the container, each in
+	// "hostPath:containerPath" form (as accepted by container.HostConfig.Binds)
+	Binds []string
+	// WorkingDir overrides the container's default working directory, if set
+	WorkingDir string
+}
+
+// NewDocker create (but does not start) a new mlab backed directly by the
+// Docker Engine SDK (github.com/docker/docker/client) instead of the `mlab`
+// CLI. It needs no `mlab` install on the host, only a reachable Docker daemon.
+//
+// Like New, if tb is not nil errors abort the test with Fatal instead of
+// being returned.
+func NewDocker(tb testing.TB, cfg DockerImageConfig) (*MLab, error) {
+	backend, err := newDockerBackend(cfg)
+	if err != nil {
+		if tb != nil {
+			tb.Fatal("mlabtest::NewDocker failed creating docker client:", err)
+		}
+		return nil, err
+	}
+
+	lab := &MLab{
+		backend: backend,
+		t:       tb,
+	}
+	if tb != nil {
+		lab.Logger = func(line string) { tb.Log(line) }
+	}
+	return lab, nil
+}
+
+// dockerBackend is a Backend implementation that talks to the Docker Engine
+// API directly, with no dependency on the `mlab` CLI.
+type dockerBackend struct {
+	cli       *client.Client
+	cfg       DockerImageConfig
+	id        string
+	closechan chan struct{}
+}
+
+func newDockerBackend(cfg DockerImageConfig) (*dockerBackend, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	return &dockerBackend{
+		cli:       cli,
+		cfg:       cfg,
+		closechan: make(chan struct{}),
+	}, nil
+}
+
+func (b *dockerBackend) Start(stdin io.Reader, stdout, stderr io.Writer) error {
+	ctx := context.Background()
+
+	if err := b.pullImage(ctx, stdout); err != nil {
+		close(b.closechan)
+		return err
+	}
+
+	exposed, bindings := b.portConfig()
+
+	resp, err := b.cli.ContainerCreate(ctx, &container.Config{
+		Image:        b.cfg.Image,
+		Env:          b.cfg.Env,
+		Cmd:          b.cfg.Cmd,
+		WorkingDir:   b.cfg.WorkingDir,
+		ExposedPorts: exposed,
+	}, &container.HostConfig{
+		PortBindings: bindings,
+		Binds:        b.cfg.Binds,
+	}, nil, nil, "")
+	if err != nil {
+		close(b.closechan)
+		return err
+	}
+	b.id = resp.ID
+
+	if err := b.cli.ContainerStart(ctx, b.id, types.ContainerStartOptions{}); err != nil {
+		close(b.closechan)
+		return err
+	}
+
+	go b.watch()
+
+	if stdout != nil || stderr != nil {
+		go b.streamLogs(stdout, stderr)
+	}
+
+	return nil
+}
+
+func (b *dockerBackend) pullImage(ctx context.Context, progress io.Writer) error {
+	rc, err := b.cli.ImagePull(ctx, b.cfg.Image, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if progress == nil {
+		progress = &nullWriter{}
+	}
+	_, err = io.Copy(progress, rc)
+	return err
+}
+
+func (b *dockerBackend) portConfig() (nat.PortSet, nat.PortMap) {
+	exposed := make(nat.PortSet)
+	bindings := make(nat.PortMap)
+	for _, port := range b.cfg.ExposedPorts {
+		p := nat.Port(fmt.Sprintf("%d/tcp", port))
+		exposed[p] = struct{}{}
+		bindings[p] = []nat.PortBinding{{}} // let docker assign the host port
+	}
+	return exposed, bindings
+}
+
+func (b *dockerBackend) watch() {
+	statusCh, errCh := b.cli.ContainerWait(context.Background(), b.id, container.WaitConditionNotRunning)
+	select {
+	case <-statusCh:
+	case <-errCh:
+	}
+	close(b.closechan)
+}
+
+func (b *dockerBackend) streamLogs(stdout, stderr io.Writer) {
+	out, err := b.cli.ContainerLogs(context.Background(), b.id, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+	})
+	if err != nil {
+		return
+	}
+	defer out.Close()
+
+	if stdout == nil {
+		stdout = &nullWriter{}
+	}
+	if stderr == nil {
+		stderr = &nullWriter{}
+	}
+	stdcopy.StdCopy(stdout, stderr, out)
+}
+
+func (b *dockerBackend) Close() error {
+	ctx := context.Background()
+	if !b.IsClosed() {
+		timeout := 0
+		b.cli.ContainerStop(ctx, b.id, container.StopOptions{Timeout: &timeout})
+	}
+	return b.cli.ContainerRemove(ctx, b.id, types.ContainerRemoveOptions{Force: true})
+}
+
+func (b *dockerBackend) Wait() {
+	<-b.closechan
+}
+
+func (b *dockerBackend) IsClosed() bool {
+	select {
+	case <-b.closechan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *dockerBackend) NetConfig() (*NetConfig, error) {
+	info, err := b.cli.ContainerInspect(context.Background(), b.id)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := make(map[string]net.IP)
+	for name, netInfo := range info.NetworkSettings.Networks {
+		if ip := net.ParseIP(netInfo.IPAddress); ip != nil {
+			interfaces[name] = ip
+		}
+	}
+
+	ports := make(map[int]int)
+	for containerPort, bindings := range info.NetworkSettings.Ports {
+		if len(bindings) == 0 {
+			continue
+		}
+		internal := containerPort.Int()
+		external, err := strconv.Atoi(bindings[0].HostPort)
+		if err != nil {
+			continue
+		}
+		ports[internal] = external
+	}
+
+	return &NetConfig{
+		Interfaces:   interfaces,
+		ExposedPorts: ports,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package mlabtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// RunDocker runs cfg.Image to completion through the Docker Engine SDK --
+// pull, create, (optionally) feed stdin, start, stream logs, wait for
+// exit, remove -- and returns an error if the container exits non-zero.
+//
+// It is meant for short one-shot commands (migrations, dumps, client
+// tools) run against an already-running lab, as an alternative to
+// shelling out to the `mlab` CLI.
+func RunDocker(ctx context.Context, cfg DockerImageConfig, stdin io.Reader, stdout, stderr io.Writer) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	rc, err := cli.ImagePull(ctx, cfg.Image, types.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	io.Copy(&nullWriter{}, rc)
+	rc.Close()
+
+	resp, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:        cfg.Image,
+		Env:          cfg.Env,
+		Cmd:          cfg.Cmd,
+		WorkingDir:   cfg.WorkingDir,
+		OpenStdin:    stdin != nil,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	}, &container.HostConfig{
+		Binds: cfg.Binds,
+	}, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	defer cli.ContainerRemove(context.Background(), resp.ID, types.ContainerRemoveOptions{Force: true})
+
+	attach, err := cli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer attach.Close()
+
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+
+	if stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, stdin)
+			attach.CloseWrite()
+		}()
+	}
+
+	if stdout == nil {
+		stdout = &nullWriter{}
+	}
+	if stderr == nil {
+		stderr = &nullWriter{}
+	}
+	copyDone := make(chan struct{})
+	go func() {
+		stdcopy.StdCopy(stdout, stderr, attach.Reader)
+		close(copyDone)
+	}()
+
+	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		return err
+	case status := <-statusCh:
+		<-copyDone
+		if status.StatusCode != 0 {
+			return fmt.Errorf("container %s exited with status %d", cfg.Image, status.StatusCode)
+		}
+	}
+	return nil
+}
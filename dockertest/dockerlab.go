@@ -1,17 +1,19 @@
 package dockertest
 
 import (
-	"errors"
+	"context"
+	"fmt"
 	"net"
-	"path"
+	"net/http"
 	"testing"
 
 	"github.com/minutelab/go-mlabtest"
+	"github.com/minutelab/go-mlabtest/containertest"
 )
 
-// DockerLab is an mlab container running Docker
+// DockerLab is a container running a Docker daemon (docker:dind), built on containertest
 type DockerLab struct {
-	lab *mlabtest.MLab
+	c *containertest.Container
 }
 
 // New creates a new DockerLab object
@@ -33,57 +35,65 @@ func New(tb testing.TB, ver string, log func(string)) (*DockerLab, error) {
 }
 
 func newDocker(tb testing.TB, ver string, log func(string)) (*DockerLab, error) {
-	scriptdir, err := mlabtest.GetSourceDir(DockerLab{})
-	if err != nil {
-		return nil, err
+	image := "docker:dind"
+	if ver != "" {
+		image = "docker:" + ver + "-dind"
 	}
 
-	success := false
+	cfg := containertest.Config{
+		Image:        image,
+		Env:          []string{"DOCKER_TLS_CERTDIR="},
+		ExposedPorts: []int{2375},
+		ReadyFunc:    ready,
+	}
 
-	lab, err := mlabtest.New(tb, path.Join(scriptdir, "dind.mlab"))
+	c, err := containertest.New(tb, cfg, log)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if !success {
-			lab.Close()
+	return &DockerLab{c: c}, nil
+}
+
+// ready is the default ReadyFunc: it hits the Docker Engine's /_ping
+// endpoint, so New only returns once the inner daemon actually answers.
+func ready(c *containertest.Container) mlabtest.ReadyFunc {
+	return func(ctx context.Context) error {
+		ip, port, err := c.GetAddressPort(2375)
+		if err != nil {
+			return err
 		}
-	}()
 
-	lab.Stdout = mlabtest.NewLineLogger(mlabtest.DefaultLogger(tb, "docker:", log))
-	lab.Stderr = lab.Stdout
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s:%d/_ping", ip.String(), port), nil)
+		if err != nil {
+			return err
+		}
 
-	if err := lab.Start(); err != nil {
-		return nil, err
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("docker ping returned status %d", resp.StatusCode)
+		}
+		return nil
 	}
-	success = true
-	return &DockerLab{
-		lab: lab,
-	}, nil
 }
 
 // Log a string
-func (p *DockerLab) Log(format string, a ...interface{}) { p.lab.Log(format, a...) }
+func (p *DockerLab) Log(format string, a ...interface{}) { p.c.Log(format, a...) }
 
 // Close mlab
 func (p *DockerLab) Close() error {
 	p.Log("DockerLab:Close")
-	return p.lab.Close()
+	return p.c.Close()
 }
 
 // GetAddressPort return the address and port used to access the Docker
 func (p *DockerLab) GetAddressPort() (net.IP, int, error) {
-	return p.lab.GetAddressPort(2375)
+	return p.c.GetAddressPort(2375)
 }
 
 // IP return the internal IP address of docker
-func (p *DockerLab) IP() (net.IP, error) {
-	conf, err := p.lab.NetConfig()
-	if err != nil {
-		return nil, err
-	}
-	if ip := conf.IP(); ip != nil {
-		return ip, nil
-	}
-	return nil, errors.New("no IP for docker container")
-}
+func (p *DockerLab) IP() (net.IP, error) { return p.c.IP() }
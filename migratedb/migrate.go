@@ -0,0 +1,121 @@
+// Package migratedb allow "unit testing" of (postgres) database whose schema is controlled by golang-migrate
+//
+// Calling New will start a container running postgres and apply all migrations
+// found in a directory of plain SQL migration files.
+// The Conn method return a connection to this database (sql.DB) that can be used for testing.
+// Close will shutdown the container.
+//
+// Reset will return an open database to the state that it was initially.
+// So the idea is that it in a TestMain (or something like that) the database would start
+// and then individual tests can start by calling Reset
+package migratedb
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+
+	"github.com/minutelab/go-mlabtest"
+	"github.com/minutelab/go-mlabtest/pgtest"
+)
+
+const testDB = "testdb"
+
+// DB represent a running database whose schema is managed by golang-migrate
+type DB struct {
+	lab  *pgtest.Postgres
+	conn *sql.DB
+	m    *migrate.Migrate
+}
+
+// New start a container and apply all migrations found in dir (a "file://" source for golang-migrate).
+// dir is the directory that contain the migration files
+// ver is the postgres version
+// if tb is not nil it is used to fail tests (so that New does not return error)
+// as well as a default for the logger function
+func New(tb testing.TB, dir string, ver string, logger func(string)) (*DB, error) {
+	db, err := doNew(tb, dir, ver, logger)
+	if err != nil && tb != nil {
+		tb.Fatal("failed initializing database: ", err)
+	}
+	return db, err
+}
+
+func doNew(tb testing.TB, dir string, ver string, logger func(string)) (*DB, error) {
+	logger = mlabtest.DefaultLogger(tb, "db:", logger)
+
+	pg, err := pgtest.New(tb, ver, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger("started database")
+
+	db := DB{lab: pg}
+	success := false
+	defer func() {
+		if !success {
+			db.Close()
+		}
+	}()
+
+	globalConn, err := pg.GetDB("")
+	if err != nil {
+		return nil, err
+	}
+	defer globalConn.Close()
+
+	if _, err := globalConn.Exec("CREATE DATABASE " + testDB); err != nil {
+		return nil, err
+	}
+
+	db.conn, err = pg.GetDB(testDB)
+	if err != nil {
+		return nil, err
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := postgres.WithInstance(db.conn, &postgres.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := migrate.NewWithDatabaseInstance("file://"+absDir, "postgres", driver)
+	if err != nil {
+		return nil, err
+	}
+
+	logger("Applying migrations")
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("error applying migrations: %s", err)
+	}
+
+	db.m = m
+	success = true
+	return &db, nil
+}
+
+// Close shut down the container
+func (d *DB) Close() error { return d.lab.Close() }
+
+// Conn return a database connection to be used in testing
+func (d *DB) Conn() *sql.DB { return d.conn }
+
+// Reset the database to its original state, by rolling all migrations down and back up again
+func (d *DB) Reset() (*sql.DB, error) {
+	if err := d.m.Down(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("error reverting migrations: %s", err)
+	}
+	if err := d.m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("error reapplying migrations: %s", err)
+	}
+	return d.conn, nil
+}
@@ -0,0 +1,38 @@
+package migratedb
+
+import "testing"
+
+func TestMigrate(t *testing.T) {
+	db, _ := New(t, "migrations", "", nil)
+	defer db.Close()
+
+	if err := db.Conn().Ping(); err != nil {
+		t.Fatal("Error pinging database:", err)
+	}
+
+	if _, err := db.Conn().Exec("INSERT INTO table1 DEFAULT VALUES"); err != nil {
+		t.Fatal("Failed inserting row:", err)
+	}
+
+	if count := countRows(t, db); count != 1 {
+		t.Fatalf("expected 1 row after insert, got %d", count)
+	}
+
+	// Reset re-runs the migrations from scratch (Down then Up), so the
+	// row inserted above is gone afterwards, not just schema changes.
+	if _, err := db.Reset(); err != nil {
+		t.Fatal("Failed reseting database:", err)
+	}
+
+	if count := countRows(t, db); count != 0 {
+		t.Errorf("expected Reset to wipe data, found %d rows", count)
+	}
+}
+
+func countRows(t *testing.T, db *DB) int {
+	var count int
+	if err := db.Conn().QueryRow("SELECT count(*) FROM table1").Scan(&count); err != nil {
+		t.Fatal("Failed counting rows:", err)
+	}
+	return count
+}
@@ -3,6 +3,7 @@ package mlabtest
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -18,6 +19,32 @@ import (
 
 var loopbackAddress = net.ParseIP("127.0.0.1")
 
+// Backend starts and controls a single lab container.
+//
+// MLab delegates all process/container handling to a Backend so that
+// callers can choose how containers are actually launched: the default
+// backend shells out to the `mlab` CLI, while NewDocker uses the Docker
+// Engine SDK directly and needs no `mlab` install on the host.
+type Backend interface {
+	// Start launches the container, wiring stdin/stdout/stderr as given
+	// (any of which may be nil), and blocks until the container is up
+	// and its id is known.
+	Start(stdin io.Reader, stdout, stderr io.Writer) error
+
+	// Close kills the container (if still running) and releases any
+	// resources held by the backend.
+	Close() error
+
+	// Wait blocks until the container has exited.
+	Wait()
+
+	// IsClosed reports whether the container has already exited.
+	IsClosed() bool
+
+	// NetConfig returns the network configuration of the running container.
+	NetConfig() (*NetConfig, error)
+}
+
 // MLab represent a running minutelab
 //
 // After creating the lab object, and possibly setting other paramters,
@@ -26,14 +53,8 @@ var loopbackAddress = net.ParseIP("127.0.0.1")
 // The lab should be closed with the Close method (even if it was only created or if start return an error)
 // The lab should be built such that when it is ready it will detach
 type MLab struct {
-	cmd        *exec.Cmd
-	outStream  io.Writer
-	outErr     io.Writer
-	idfile     string        // file containing the container id
-	id         string        // the container id
-	closechan  chan struct{} // this channel will be closed once the lab process is dead (or if start failed to start it)
-	toBeClosed []io.Closer
-	netConfig  *NetConfig
+	backend   Backend
+	netConfig *NetConfig
 
 	t testing.TB // testing object related to this lab
 
@@ -47,8 +68,20 @@ type MLab struct {
 	// (stdout is not connected directly)
 	Stdout io.Writer
 	Stderr io.Writer
+
+	// ReadyFunc, if set, is polled (with exponential backoff) by
+	// StartContext once the container is up, and StartContext only
+	// returns once it succeeds or the context expires. It lets callers
+	// detect when the service inside the container actually accepts
+	// requests, rather than just that the container process exists.
+	// Must be set before calling Start/StartContext.
+	ReadyFunc ReadyFunc
 }
 
+// ReadyFunc probes whether a lab is actually ready to serve requests,
+// given a context that bounds how long the caller is willing to wait.
+type ReadyFunc func(ctx context.Context) error
+
 // NetConfig is the network configuration of a lab
 type NetConfig struct {
 	Interfaces   map[string]net.IP
@@ -82,26 +115,21 @@ func (n *NetConfig) IP() net.IP {
 // 1. Both New and Start won't return errors, instead the would abort the test
 //    using Fatal, so testing code does not need to explicitly check for errors
 // 2. It will send logs about lab setup through the testing log function
+//
+// New uses the `mlab` CLI backend. Use NewDocker to talk to the Docker
+// Engine directly instead.
 func New(tb testing.TB, script string, args ...string) (*MLab, error) {
-	// create temporary file to hold the container id
-	idfile, err := ioutil.TempFile("", "tmlab.")
+	backend, err := newCLIBackend(script, args...)
 	if err != nil {
 		if tb != nil {
 			tb.Fatal("mlabtest::New failed creating temp file:", err)
 		}
 		return nil, err
 	}
-	idfname := idfile.Name()
-	idfile.Close()
-
-	pargs := []string{"run", "--wait", "--id", idfname, script}
-	pargs = append(pargs, args...)
 
 	lab := &MLab{
-		cmd:       exec.Command("mlab", pargs...),
-		idfile:    idfname,
-		t:         tb,
-		closechan: make(chan struct{}),
+		backend: backend,
+		t:       tb,
 	}
 	if tb != nil {
 		lab.Logger = func(line string) { tb.Log(line) }
@@ -131,115 +159,244 @@ func (m *MLab) Log(format string, a ...interface{}) {
 // Close kills the mlab if neccesary and clean after it
 func (m *MLab) Close() error {
 	m.Log("MLab:Close")
-	if !m.IsClosed() {
-		m.Log("Actually killing process")
-		// process is still alive
-		m.cmd.Process.Kill()
-	}
-
-	for _, c := range m.toBeClosed {
-		c.Close()
-	}
-
-	os.Remove(m.idfile)
-	return nil
+	return m.backend.Close()
 }
 
-// Start the lab
+// Start the lab. Equivalent to StartContext(context.Background()).
 func (m *MLab) Start() error {
-	err := m.doStart()
+	return m.StartContext(context.Background())
+}
+
+// StartContext starts the lab and, if ReadyFunc is set, blocks until it
+// reports success or ctx is done, whichever comes first, polling with
+// exponential backoff in between.
+func (m *MLab) StartContext(ctx context.Context) error {
+	err := m.doStart(ctx)
 	if err != nil && m.t != nil {
 		m.t.Fatal("Failed starting MLab")
 	}
 	return err
 }
 
-func (m *MLab) doStart() error {
+func (m *MLab) doStart(ctx context.Context) error {
+	var stdin io.Reader
 	if m.Stdin != nil {
-		m.cmd.Stdin = m.Stdin
+		stdin = m.Stdin
+	}
+	if err := m.backend.Start(stdin, m.Stdout, m.Stderr); err != nil {
+		return err
+	}
+	if m.ReadyFunc == nil {
+		return nil
+	}
+	return m.waitReady(ctx)
+}
+
+// waitReady polls ReadyFunc with exponential backoff (capped at 1s) until
+// it succeeds or ctx expires.
+func (m *MLab) waitReady(ctx context.Context) error {
+	backoff := 10 * time.Millisecond
+	for {
+		err := m.ReadyFunc(ctx)
+		if err == nil {
+			return nil
+		}
+		m.Log("not ready yet: %s", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("lab did not become ready: %w (last error: %s)", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > time.Second {
+			backoff = time.Second
+		}
+	}
+}
+
+// Wait until the lab died (or start failed to start it)
+func (m *MLab) Wait() {
+	m.backend.Wait()
+}
+
+// IsClosed true if the command is closed
+func (m *MLab) IsClosed() bool {
+	return m.backend.IsClosed()
+}
+
+// NetConfig get the network configuration of a running container
+// result is cached, so future calls are fast
+func (m *MLab) NetConfig() (*NetConfig, error) {
+	if m.netConfig != nil {
+		return m.netConfig, nil
+	}
+
+	nc, err := m.backend.NetConfig()
+	if err == nil {
+		m.netConfig = nc
+	}
+	return nc, err
+}
+
+// GetAddressPort return the address and port to be used to access the specified internal port
+func (m *MLab) GetAddressPort(port int) (net.IP, int, error) {
+	conf, err := m.NetConfig()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if !NeedForwarding() {
+		ip := conf.IP()
+		if ip != nil {
+			return ip, port, nil
+		}
+		// we don't have IP? we would probably fail, but let's try also forwarding
+	}
+
+	if fport, ok := conf.ExposedPorts[port]; ok {
+		return loopbackAddress, fport, nil
+	}
+	return nil, 0, fmt.Errorf("could not find port mapping for %d", port)
+}
+
+// NeedForwarding return true if the labs need to be accessed at 127.0.0.1 with the mapped ports
+// otherwise they can be accessed at their own address with the original port
+func NeedForwarding() bool {
+	return !strings.HasPrefix(os.Getenv("MLAB_HOST"), "unix:")
+}
+
+type nullWriter struct{}
+
+func (n *nullWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+// cliBackend is the original Backend implementation: it shells out to the
+// `mlab` CLI and parses its JSON templated output.
+type cliBackend struct {
+	cmd        *exec.Cmd
+	idfile     string        // file containing the container id
+	id         string        // the container id
+	closechan  chan struct{} // this channel will be closed once the lab process is dead (or if start failed to start it)
+	toBeClosed []io.Closer
+}
+
+func newCLIBackend(script string, args ...string) (*cliBackend, error) {
+	// create temporary file to hold the container id
+	idfile, err := ioutil.TempFile("", "tmlab.")
+	if err != nil {
+		return nil, err
+	}
+	idfname := idfile.Name()
+	idfile.Close()
+
+	pargs := []string{"run", "--wait", "--id", idfname, script}
+	pargs = append(pargs, args...)
+
+	return &cliBackend{
+		cmd:       exec.Command("mlab", pargs...),
+		idfile:    idfname,
+		closechan: make(chan struct{}),
+	}, nil
+}
+
+func (b *cliBackend) Start(stdin io.Reader, stdout, stderr io.Writer) error {
+	if stdin != nil {
+		b.cmd.Stdin = stdin
 	} else {
 		// TODO: at the time of writing, if we want to detach+wait, we cannot close stdin
 		// So if we don't have anything else (the normal thing) we use a reader that blocks
 		br := newBlockingReader()
-		m.cmd.Stdin = br
-		m.toBeClosed = append(m.toBeClosed, br)
+		b.cmd.Stdin = br
+		b.toBeClosed = append(b.toBeClosed, br)
 	}
 
-	if m.Stderr != nil {
-		m.cmd.Stderr = m.Stderr
+	if stderr != nil {
+		b.cmd.Stderr = stderr
 	}
 
-	out := m.Stdout
+	out := stdout
 	if out == nil {
 		out = &nullWriter{}
 	}
 
-	pipe, err := m.cmd.StdoutPipe()
+	pipe, err := b.cmd.StdoutPipe()
 	if err != nil {
 		return err
 	}
 
-	if err := m.cmd.Start(); err != nil {
-		close(m.closechan)
+	if err := b.cmd.Start(); err != nil {
+		close(b.closechan)
 		return err
 	}
 
 	go func() {
-		m.cmd.Wait()
-		close(m.closechan)
+		b.cmd.Wait()
+		close(b.closechan)
 	}()
 
 	if _, err := io.Copy(out, pipe); err != nil {
 		return err
 	}
 
-	select {
-	case <-m.closechan:
-		return fmt.Errorf("mlab exited: %s", m.cmd.ProcessState.String())
+	id, err := b.waitForID()
+	if err != nil {
+		return err
+	}
+	b.id = id
+	return nil
+}
 
-	case <-time.NewTimer(50 * time.Millisecond).C:
-		// TODO: do we really need to wait here
+// waitForID polls the id file until the mlab CLI has written the
+// container id to it, or the process exits first.
+func (b *cliBackend) waitForID() (string, error) {
+	backoff := time.Millisecond
+	for {
+		data, err := ioutil.ReadFile(b.idfile)
+		if err == nil {
+			if id := bytes.TrimSpace(data); len(id) > 0 {
+				return string(id), nil
+			}
+		}
+
+		select {
+		case <-b.closechan:
+			return "", fmt.Errorf("mlab exited: %s", b.cmd.ProcessState.String())
+		case <-time.After(backoff):
+		}
+		if backoff < 100*time.Millisecond {
+			backoff *= 2
+		}
 	}
+}
 
-	id, err := ioutil.ReadFile(m.idfile)
-	if err != nil {
-		return err
+func (b *cliBackend) Close() error {
+	if !b.IsClosed() {
+		// process is still alive
+		b.cmd.Process.Kill()
 	}
-	m.id = string(bytes.TrimSpace(id))
+
+	for _, c := range b.toBeClosed {
+		c.Close()
+	}
+
+	os.Remove(b.idfile)
 	return nil
 }
 
-// Wait until the lab died (or start failed to start it)
-func (m *MLab) Wait() {
-	<-m.closechan
+func (b *cliBackend) Wait() {
+	<-b.closechan
 }
 
-// IsClosed true if the command is closed
-func (m *MLab) IsClosed() bool {
+func (b *cliBackend) IsClosed() bool {
 	select {
-	case <-m.closechan:
+	case <-b.closechan:
 		return true
 	default:
 		return false
 	}
 }
 
-// NetConfig get the network configuration of a running container
-// result is cached, so future calls are fast
-func (m *MLab) NetConfig() (*NetConfig, error) {
-	if m.netConfig != nil {
-		return m.netConfig, nil
-	}
-
-	nc, err := m.getNetConfig()
-	if err == nil {
-		m.netConfig = nc
-	}
-	return nc, err
-}
-
-func (m *MLab) getNetConfig() (*NetConfig, error) {
-	out, err := exec.Command("mlab", "inspect", "-f", `{{json .config.Network.interfaces}} {{json .config.Network.exposed}}`, m.id).CombinedOutput()
+func (b *cliBackend) NetConfig() (*NetConfig, error) {
+	out, err := exec.Command("mlab", "inspect", "-f", `{{json .config.Network.interfaces}} {{json .config.Network.exposed}}`, b.id).CombinedOutput()
 	if err != nil {
 		return nil, err
 	}
@@ -284,37 +441,6 @@ func (m *MLab) getNetConfig() (*NetConfig, error) {
 	}, nil
 }
 
-// GetAddressPort return the address and port to be used to access the specified internal port
-func (m *MLab) GetAddressPort(port int) (net.IP, int, error) {
-	conf, err := m.NetConfig()
-	if err != nil {
-		return nil, 0, err
-	}
-
-	if !NeedForwarding() {
-		ip := conf.IP()
-		if ip != nil {
-			return ip, port, nil
-		}
-		// we don't have IP? we would probably fail, but let's try also forwarding
-	}
-
-	if fport, ok := conf.ExposedPorts[port]; ok {
-		return loopbackAddress, fport, nil
-	}
-	return nil, 0, fmt.Errorf("could not find port mapping for %d", port)
-}
-
-// NeedForwarding return true if the labs need to be accessed at 127.0.0.1 with the mapped ports
-// otherwise they can be accessed at their own address with the original port
-func NeedForwarding() bool {
-	return !strings.HasPrefix(os.Getenv("MLAB_HOST"), "unix:")
-}
-
-type nullWriter struct{}
-
-func (n *nullWriter) Write(p []byte) (int, error) { return len(p), nil }
-
 // blockingRreader is a dummy io.ReadCloser: any read on it will block,
 // until it is closed. Once it is closed, any reads (past and future)
 // will return immediatly with no data and EOF
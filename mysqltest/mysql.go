@@ -0,0 +1,107 @@
+// Package mysqltest starts a mysql container for use in tests, built on
+// the generic containertest package.
+package mysqltest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql" // we use mysql, we need to import the library for side effect
+
+	"github.com/minutelab/go-mlabtest"
+	"github.com/minutelab/go-mlabtest/containertest"
+)
+
+const rootPassword = "mlabtest"
+
+// MySQL is a container running mysql, built on containertest
+type MySQL struct {
+	c *containertest.Container
+}
+
+// New create a new MySQL object
+// it starts a mysql database of the specified version, and allows
+// processes to connect to it
+//
+// if tb is not null the MySQL object is related to this testing object:
+// logs will be sent to it, and New either succeeds or fails the test with
+// Fatal, so errors don't need to be tested.
+//
+// log is optional function to log stderr/stdout of the database,
+// can be nil and then default are used (either tb.Log or stdout)
+func New(tb testing.TB, ver string, log func(string)) (*MySQL, error) {
+	m, err := newMySQL(tb, ver, log)
+	if err != nil && tb != nil {
+		tb.Fatal("Error starting mysql: ", err)
+	}
+	return m, err
+}
+
+func newMySQL(tb testing.TB, ver string, log func(string)) (*MySQL, error) {
+	image := "mysql"
+	if ver != "" {
+		image = "mysql:" + ver
+	}
+
+	cfg := containertest.Config{
+		Image:        image,
+		Env:          []string{"MYSQL_ROOT_PASSWORD=" + rootPassword},
+		ExposedPorts: []int{3306},
+		ReadyFunc:    ready,
+	}
+
+	c, err := containertest.New(tb, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return &MySQL{c: c}, nil
+}
+
+// ready is the default ReadyFunc: it runs SELECT 1, so New only returns
+// once the database actually accepts connections and queries.
+func ready(c *containertest.Container) mlabtest.ReadyFunc {
+	return func(ctx context.Context) error {
+		ip, port, err := c.GetAddressPort(3306)
+		if err != nil {
+			return err
+		}
+
+		db, err := sql.Open("mysql", fmt.Sprintf("root:%s@tcp(%s:%d)/", rootPassword, ip.String(), port))
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+
+		var one int
+		return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	}
+}
+
+// Log a string
+func (m *MySQL) Log(format string, a ...interface{}) { m.c.Log(format, a...) }
+
+// Close releases resources connected to the mysql object (in particular kill the container)
+func (m *MySQL) Close() error {
+	m.c.Log("MySQL:Close")
+	return m.c.Close()
+}
+
+// GetDB get an sql.DB object connected to the mysql server with the specified database name
+func (m *MySQL) GetDB(name string) (*sql.DB, error) {
+	ip, port, err := m.GetAddressPort()
+	if err != nil {
+		return nil, err
+	}
+	dsn := fmt.Sprintf("root:%s@tcp(%s:%d)/%s", rootPassword, ip.String(), port, name)
+	m.Log("DSN: %s", dsn)
+	return sql.Open("mysql", dsn)
+}
+
+// GetAddressPort return the address and port used to access mysql
+func (m *MySQL) GetAddressPort() (net.IP, int, error) { return m.c.GetAddressPort(3306) }
+
+// IP return the internal IP address of the mysql container
+func (m *MySQL) IP() (net.IP, error) { return m.c.IP() }
@@ -0,0 +1,18 @@
+package mysqltest
+
+import "testing"
+
+func TestMySQL(t *testing.T) {
+	m, _ := New(t, "", nil)
+	defer m.Close()
+
+	db, err := m.GetDB("")
+	if err != nil {
+		t.Fatal("Failed creating db object:", err)
+	}
+	defer db.Close()
+
+	if err := db.Ping(); err != nil {
+		t.Fatal("Failed pinging database:", err)
+	}
+}
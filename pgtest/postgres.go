@@ -1,21 +1,21 @@
 package pgtest
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"net"
-	"path"
 	"testing"
 
 	_ "github.com/lib/pq" // we use postgres, we need to iport the library for side effect
 
 	"github.com/minutelab/go-mlabtest"
+	"github.com/minutelab/go-mlabtest/containertest"
 )
 
-// Postgres is an mlab container running postgres
+// Postgres is a container running postgres, built on containertest
 type Postgres struct {
-	lab *mlabtest.MLab
+	c *containertest.Container
 }
 
 // New create a new Postgres object
@@ -37,47 +37,52 @@ func New(tb testing.TB, ver string, log func(string)) (*Postgres, error) {
 }
 
 func newPostgres(tb testing.TB, ver string, log func(string)) (*Postgres, error) {
-	scriptdir, err := mlabtest.GetSourceDir(Postgres{})
-	if err != nil {
-		return nil, err
+	image := "postgres"
+	if ver != "" {
+		image = "postgres:" + ver
 	}
 
-	success := false
-
-	args := []string{"-port", "0", "-detach"}
-	if ver != "" {
-		args = append(args, "-ver", ver)
+	cfg := containertest.Config{
+		Image:        image,
+		Env:          []string{"POSTGRES_HOST_AUTH_METHOD=trust"},
+		ExposedPorts: []int{5432},
+		ReadyFunc:    ready,
 	}
-	lab, err := mlabtest.New(tb, path.Join(scriptdir, "postgres.mlab"), args...)
+
+	c, err := containertest.New(tb, cfg, log)
 	if err != nil {
 		return nil, err
 	}
-	defer func() {
-		if !success {
-			lab.Close()
+	return &Postgres{c: c}, nil
+}
+
+// ready is the default ReadyFunc: it runs SELECT 1, so New only returns
+// once the database actually accepts connections and queries.
+func ready(c *containertest.Container) mlabtest.ReadyFunc {
+	return func(ctx context.Context) error {
+		ip, port, err := c.GetAddressPort(5432)
+		if err != nil {
+			return err
 		}
-	}()
 
-	lab.Stdout = mlabtest.NewLineLogger(mlabtest.DefaultLogger(tb, "pg:", log))
-	lab.Stderr = lab.Stdout
+		db, err := sql.Open("postgres", fmt.Sprintf("postgres://postgres@%s:%d/?sslmode=disable", ip.String(), port))
+		if err != nil {
+			return err
+		}
+		defer db.Close()
 
-	if err := lab.Start(); err != nil {
-		return nil, err
+		var one int
+		return db.QueryRowContext(ctx, "SELECT 1").Scan(&one)
 	}
-
-	success = true
-	return &Postgres{
-		lab: lab,
-	}, nil
 }
 
 // Log a string
-func (p *Postgres) Log(format string, a ...interface{}) { p.lab.Log(format, a...) }
+func (p *Postgres) Log(format string, a ...interface{}) { p.c.Log(format, a...) }
 
 // Close releases resources connected to the postgres object (in particular kill the container)
 func (p *Postgres) Close() error {
-	p.lab.Log("Posgres:Close")
-	return p.lab.Close()
+	p.c.Log("Posgres:Close")
+	return p.c.Close()
 }
 
 // GetDB get an sql.DB object conected to the postgres with the specified database name
@@ -92,16 +97,7 @@ func (p *Postgres) GetDB(name string) (*sql.DB, error) {
 }
 
 // GetAddressPort return the address and port used to access the DB
-func (p *Postgres) GetAddressPort() (net.IP, int, error) { return p.lab.GetAddressPort(5432) }
+func (p *Postgres) GetAddressPort() (net.IP, int, error) { return p.c.GetAddressPort(5432) }
 
 // IP return the internal IP address of postgress
-func (p *Postgres) IP() (net.IP, error) {
-	conf, err := p.lab.NetConfig()
-	if err != nil {
-		return nil, err
-	}
-	if ip := conf.IP(); ip != nil {
-		return ip, nil
-	}
-	return nil, errors.New("no IP for postgess container")
-}
+func (p *Postgres) IP() (net.IP, error) { return p.c.IP() }
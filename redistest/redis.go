@@ -0,0 +1,108 @@
+// Package redistest starts a redis container for use in tests, built on
+// the generic containertest package.
+package redistest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/minutelab/go-mlabtest"
+	"github.com/minutelab/go-mlabtest/containertest"
+)
+
+// Redis is a container running redis, built on containertest
+type Redis struct {
+	c *containertest.Container
+}
+
+// New create a new Redis object
+// it starts a redis server of the specified version, and allows
+// processes to connect to it
+//
+// if tb is not null the Redis object is related to this testing object:
+// logs will be sent to it, and New either succeeds or fails the test with
+// Fatal, so errors don't need to be tested.
+//
+// log is optional function to log stderr/stdout of the server,
+// can be nil and then default are used (either tb.Log or stdout)
+func New(tb testing.TB, ver string, log func(string)) (*Redis, error) {
+	r, err := newRedis(tb, ver, log)
+	if err != nil && tb != nil {
+		tb.Fatal("Error starting redis: ", err)
+	}
+	return r, err
+}
+
+func newRedis(tb testing.TB, ver string, log func(string)) (*Redis, error) {
+	image := "redis"
+	if ver != "" {
+		image = "redis:" + ver
+	}
+
+	cfg := containertest.Config{
+		Image:        image,
+		ExposedPorts: []int{6379},
+		ReadyFunc:    ready,
+	}
+
+	c, err := containertest.New(tb, cfg, log)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{c: c}, nil
+}
+
+// ready is the default ReadyFunc: it sends a raw PING and expects PONG
+// back, so New only returns once the server actually accepts commands.
+func ready(c *containertest.Container) mlabtest.ReadyFunc {
+	return func(ctx context.Context) error {
+		ip, port, err := c.GetAddressPort(6379)
+		if err != nil {
+			return err
+		}
+
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", ip.String(), port))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			return err
+		}
+
+		reply, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(reply) != "+PONG" {
+			return fmt.Errorf("unexpected PING reply: %q", reply)
+		}
+		return nil
+	}
+}
+
+// Log a string
+func (r *Redis) Log(format string, a ...interface{}) { r.c.Log(format, a...) }
+
+// Close releases resources connected to the redis object (in particular kill the container)
+func (r *Redis) Close() error {
+	r.c.Log("Redis:Close")
+	return r.c.Close()
+}
+
+// GetAddressPort return the address and port used to access redis
+func (r *Redis) GetAddressPort() (net.IP, int, error) { return r.c.GetAddressPort(6379) }
+
+// IP return the internal IP address of the redis container
+func (r *Redis) IP() (net.IP, error) { return r.c.IP() }
+
+// Ping sends a raw PING command, returning an error if redis doesn't
+// reply PONG.
+func (r *Redis) Ping() error {
+	return ready(r.c)(context.Background())
+}
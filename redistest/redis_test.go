@@ -0,0 +1,12 @@
+package redistest
+
+import "testing"
+
+func TestRedis(t *testing.T) {
+	r, _ := New(t, "", nil)
+	defer r.Close()
+
+	if err := r.Ping(); err != nil {
+		t.Fatal("Failed pinging redis:", err)
+	}
+}
@@ -0,0 +1,57 @@
+package sqitchdb
+
+import (
+	"database/sql"
+	"fmt"
+	"sync/atomic"
+)
+
+var forkSeq int64
+
+// ForkedDB is a fresh, fully-migrated database cloned from the shared
+// template on the same container. Unlike Reset, forking never touches
+// testdb or any other fork, so it is safe to use from t.Parallel tests
+// sharing a single container.
+type ForkedDB struct {
+	parent *DB
+	name   string
+	conn   *sql.DB
+}
+
+// Fork creates a new, uniquely named database on the same container,
+// cloned from the template left behind by New, and returns a connection
+// to it. Fork requires the template-database path (see makeTemplate); it
+// returns an error if New had to fall back to the pg_dump path.
+func (d *DB) Fork() (*ForkedDB, error) {
+	if d.useDump {
+		return nil, fmt.Errorf("sqitchdb: Fork requires the template-database path, not the pg_dump fallback")
+	}
+
+	name := fmt.Sprintf("%s_fork_%d", testDB, atomic.AddInt64(&forkSeq, 1))
+	if _, err := d.globalConn.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", name, templateDB)); err != nil {
+		return nil, err
+	}
+
+	conn, err := d.lab.GetDB(name)
+	if err != nil {
+		d.globalConn.Exec("DROP DATABASE " + name)
+		return nil, err
+	}
+
+	return &ForkedDB{parent: d, name: name, conn: conn}, nil
+}
+
+// Conn return the database connection for this fork
+func (f *ForkedDB) Conn() *sql.DB { return f.conn }
+
+// Close disconnects from and drops the forked database
+func (f *ForkedDB) Close() error {
+	if err := f.conn.Close(); err != nil {
+		f.parent.lab.Log("Error closing forked db %s: %s", f.name, err)
+	}
+	if _, err := f.parent.globalConn.Exec(fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s'", f.name)); err != nil {
+		f.parent.lab.Log("Failed removing connections to %s: %s", f.name, err)
+	}
+	_, err := f.parent.globalConn.Exec("DROP DATABASE " + f.name)
+	return err
+}
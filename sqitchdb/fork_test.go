@@ -0,0 +1,29 @@
+package sqitchdb
+
+import "testing"
+
+func TestFork(t *testing.T) {
+	db, _ := New(t, "scheme", "", nil)
+	// Cleanup, not defer: the parallel subtests only run after this
+	// function returns, and need the container until they finish.
+	t.Cleanup(func() { db.Close() })
+
+	t.Run("a", func(t *testing.T) {
+		t.Parallel()
+		forkAndCheck(t, db)
+	})
+	t.Run("b", func(t *testing.T) {
+		t.Parallel()
+		forkAndCheck(t, db)
+	})
+}
+
+func forkAndCheck(t *testing.T, db *DB) {
+	fork, err := db.Fork()
+	if err != nil {
+		t.Fatal("Failed forking database:", err)
+	}
+	defer fork.Close()
+
+	hasTable(t, fork.Conn(), "table1")
+}
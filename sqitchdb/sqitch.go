@@ -11,9 +11,9 @@ package sqitchdb
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"os/exec"
 	"path/filepath"
 	"testing"
 
@@ -21,15 +21,25 @@ import (
 	"github.com/minutelab/go-mlabtest/pgtest"
 )
 
-const testDB = "testdb"
+const (
+	testDB     = "testdb"
+	templateDB = "testdb_template"
+
+	// sqitchImage is used to run `sqitch deploy` against the schema
+	// directory mounted at sqitchMountDir, and postgresImage to run the
+	// pg_dump/psql fallback -- neither needs an `mlab` install on the host.
+	sqitchImage    = "sqitch/sqitch"
+	postgresImage  = "postgres"
+	sqitchMountDir = "/repo"
+)
 
 // DB represent a running database
 type DB struct {
 	lab        *pgtest.Postgres
 	globalConn *sql.DB
 	conn       *sql.DB
-	pgclient   string
-	resetState []byte
+	useDump    bool   // true if the template-database fast path isn't available and we fall back to pg_dump
+	resetState []byte // pg_dump snapshot, only populated when useDump is true
 	ip         string // internal IP of database
 }
 
@@ -47,12 +57,6 @@ func New(tb testing.TB, dir string, ver string, logger func(string)) (*DB, error
 }
 
 func doNew(tb testing.TB, dir string, ver string, logger func(string)) (*DB, error) {
-	// We will need the directory later, lets get it while it is quick and easy to fail
-	sqitchdir, err := mlabtest.GetSourceDir(DB{})
-	if err != nil {
-		return nil, err
-	}
-
 	logger = mlabtest.DefaultLogger(tb, "db:", logger)
 
 	// run the database
@@ -69,9 +73,8 @@ func doNew(tb testing.TB, dir string, ver string, logger func(string)) (*DB, err
 	}
 
 	db := DB{
-		lab:      pg,
-		pgclient: filepath.Join(sqitchdir, "pgclient.mlab"),
-		ip:       ip.String(),
+		lab: pg,
+		ip:  ip.String(),
 	}
 	success := false
 	defer func() {
@@ -95,30 +98,115 @@ func doNew(tb testing.TB, dir string, ver string, logger func(string)) (*DB, err
 		return nil, err
 	}
 
-	deployCmd := exec.Command("mlab", "run", filepath.Join(sqitchdir, "sqitch.mlab"), "-host", db.ip, "-port", "5432", "-schema", dir, "--", "--db-name", testDB, "deploy")
-	lineLogger := mlabtest.NewLineLogger(logger)
-	deployCmd.Stdout = lineLogger
-	deployCmd.Stderr = lineLogger
-	if err := deployCmd.Run(); err != nil {
+	if err := db.deploy(dir, logger); err != nil {
 		return nil, err
 	}
 
-	logger("Getting schema")
-	dumpCmd := db.clientCmd("pg_dump", "-C", testDB)
-	dumpCmd.Stderr = lineLogger
-	out, err := dumpCmd.Output()
-	// fmt.Fprintln(os.Stderr, string(out))
-	if err != nil {
-		db.lab.Log("Error running dump: %s", err)
-		return nil, fmt.Errorf("Error running pg_dump: %s", err)
+	if err := db.makeTemplate(logger); err != nil {
+		logger(fmt.Sprintf("template database path unavailable (%s), falling back to pg_dump snapshot", err))
+		if err := db.dumpSchema(logger); err != nil {
+			return nil, err
+		}
 	}
-	db.lab.Log("Got schema: %d bytes", len(out))
 
-	db.resetState = out
 	success = true
 	return &db, nil
 }
 
+// deploy runs `sqitch deploy` against testdb, through the Docker Engine
+// SDK rather than an `mlab` install on the host: dir (the sqitch schema,
+// containing sqitch.plan) is bind-mounted into a throwaway sqitch/sqitch
+// container.
+func (d *DB) deploy(dir string, logger func(string)) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	lineLogger := mlabtest.NewLineLogger(logger)
+	return mlabtest.RunDocker(context.Background(), mlabtest.DockerImageConfig{
+		Image:      sqitchImage,
+		Binds:      []string{absDir + ":" + sqitchMountDir},
+		WorkingDir: sqitchMountDir,
+		Cmd:        []string{"deploy", fmt.Sprintf("db:pg://postgres@%s:5432/%s", d.ip, testDB)},
+	}, nil, lineLogger, lineLogger)
+}
+
+// makeTemplate turns the just-deployed testdb into a template database
+// (testdb_template) that Reset can cheaply clone from with
+// CREATE DATABASE ... TEMPLATE, instead of a pg_dump/restore round trip.
+//
+// If any step after the rename fails (e.g. IS_TEMPLATE or CREATE DATABASE
+// being refused for permission/extension reasons), IS_TEMPLATE is cleared
+// and the rename is undone, so that testdb still exists as an ordinary
+// database that dumpSchema can fall back to pg_dump against and Reset can
+// drop. Either way, d.conn is left pointing at a live testdb.
+func (d *DB) makeTemplate(logger func(string)) error {
+	logger("Snapshotting schema into a template database")
+
+	if err := d.conn.Close(); err != nil {
+		d.lab.Log("Error closing db: %s", err)
+	}
+
+	renamed := false
+	err := func() error {
+		if _, err := d.globalConn.Exec(fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", testDB, templateDB)); err != nil {
+			return err
+		}
+		renamed = true
+
+		if _, err := d.globalConn.Exec(fmt.Sprintf("ALTER DATABASE %s IS_TEMPLATE true", templateDB)); err != nil {
+			return err
+		}
+
+		if _, err := d.globalConn.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", testDB, templateDB)); err != nil {
+			return err
+		}
+		return nil
+	}()
+
+	if err != nil && renamed {
+		// roll back the rename so testdb still exists for dumpSchema to fall back to;
+		// a template database cannot be dropped, so clear IS_TEMPLATE first
+		if _, rerr := d.globalConn.Exec(fmt.Sprintf("ALTER DATABASE %s IS_TEMPLATE false", templateDB)); rerr != nil {
+			d.lab.Log("Failed clearing IS_TEMPLATE: %s", rerr)
+		}
+		if _, rerr := d.globalConn.Exec(fmt.Sprintf("ALTER DATABASE %s RENAME TO %s", templateDB, testDB)); rerr != nil {
+			d.lab.Log("Failed rolling back template rename: %s", rerr)
+		}
+	}
+
+	// testdb exists either way now (untouched, rolled back, or freshly
+	// recreated from the template) -- reconnect to it regardless of err
+	conn, connErr := d.lab.GetDB(testDB)
+	if connErr == nil {
+		d.conn = conn
+	}
+	if err == nil {
+		err = connErr
+	}
+	return err
+}
+
+// dumpSchema is the original, slower Reset path: it takes a pg_dump of
+// testdb through a throwaway postgres-image container, and Reset restores
+// it with psql the same way.
+func (d *DB) dumpSchema(logger func(string)) error {
+	logger("Getting schema")
+	lineLogger := mlabtest.NewLineLogger(logger)
+
+	var out bytes.Buffer
+	if err := mlabtest.RunDocker(context.Background(), d.clientConfig("pg_dump", "-h", d.ip, "-U", "postgres", "-C", testDB), nil, &out, lineLogger); err != nil {
+		d.lab.Log("Error running dump: %s", err)
+		return fmt.Errorf("Error running pg_dump: %s", err)
+	}
+	d.lab.Log("Got schema: %d bytes", out.Len())
+
+	d.useDump = true
+	d.resetState = out.Bytes()
+	return nil
+}
+
 // Close shut down the contaienr
 func (d *DB) Close() error { return d.lab.Close() }
 
@@ -127,24 +215,46 @@ func (d *DB) Conn() *sql.DB { return d.conn }
 
 // Reset the database to its original state
 func (d *DB) Reset() (*sql.DB, error) {
-	if err := d.conn.Close(); err != nil {
-		d.lab.Log("Error closing db: %s", err)
+	if d.useDump {
+		return d.resetFromDump()
 	}
-	// It seems that even though we close the connection the go postgres implementation doesn't close the connections to the database
-	// so the database think that there are still user intereseted in the db and prevent us from dropping it.
-	// its a hack, but we just forcfully remove those connections`
-	if _, err := d.globalConn.Exec(fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s'", testDB)); err != nil {
-		d.lab.Log("Failed removing connections: %s", err)
+	return d.resetFromTemplate()
+}
+
+// resetFromTemplate drops testdb and recreates it from testdb_template.
+// This is orders of magnitude faster than the pg_dump/restore path and
+// needs no external pg_dump/psql client container.
+func (d *DB) resetFromTemplate() (*sql.DB, error) {
+	if err := d.disconnect(); err != nil {
+		return nil, err
+	}
+
+	if _, err := d.globalConn.Exec("DROP DATABASE " + testDB); err != nil {
+		return nil, err
+	}
+
+	if _, err := d.globalConn.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s", testDB, templateDB)); err != nil {
+		return nil, err
+	}
+
+	var err error
+	d.conn, err = d.lab.GetDB(testDB)
+	return d.conn, err
+}
+
+func (d *DB) resetFromDump() (*sql.DB, error) {
+	if err := d.disconnect(); err != nil {
+		return nil, err
 	}
 
 	if _, err := d.globalConn.Exec("DROP DATABASE " + testDB); err != nil {
 		return nil, err
 	}
 
-	restoreCmd := d.clientCmd("")
-	restoreCmd.Stdin = bytes.NewReader(d.resetState)
-	if out, err := restoreCmd.CombinedOutput(); err != nil {
-		d.lab.Log("Failed reseting database err='%s', out='%s'", err, string(out))
+	lineLogger := mlabtest.NewLineLogger(func(line string) { d.lab.Log("%s", line) })
+	stdin := bytes.NewReader(d.resetState)
+	if err := mlabtest.RunDocker(context.Background(), d.clientConfig("psql", "-h", d.ip, "-U", "postgres"), stdin, lineLogger, lineLogger); err != nil {
+		d.lab.Log("Failed reseting database: %s", err)
 		return nil, err
 	}
 
@@ -153,13 +263,26 @@ func (d *DB) Reset() (*sql.DB, error) {
 	return d.conn, err
 }
 
-func (d *DB) clientCmd(cmd string, clientArgs ...string) *exec.Cmd {
-	args := []string{"run", d.pgclient, "-host", d.ip}
-	if cmd != "" {
-		args = append(args, "-cmd", cmd)
+// disconnect closes the current testdb connection and forcefully removes
+// any other connections to it so it can be dropped.
+func (d *DB) disconnect() error {
+	if err := d.conn.Close(); err != nil {
+		d.lab.Log("Error closing db: %s", err)
+	}
+	// It seems that even though we close the connection the go postgres implementation doesn't close the connections to the database
+	// so the database think that there are still user intereseted in the db and prevent us from dropping it.
+	// its a hack, but we just forcfully remove those connections`
+	if _, err := d.globalConn.Exec(fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s'", testDB)); err != nil {
+		d.lab.Log("Failed removing connections: %s", err)
+	}
+	return nil
+}
+
+// clientConfig builds the DockerImageConfig for a one-shot postgres client
+// tool (pg_dump, psql, ...) run against this database via mlabtest.RunDocker.
+func (d *DB) clientConfig(cmd string, args ...string) mlabtest.DockerImageConfig {
+	return mlabtest.DockerImageConfig{
+		Image: postgresImage,
+		Cmd:   append([]string{cmd}, args...),
 	}
-	args = append(args, "--")
-	args = append(args, clientArgs...)
-	d.lab.Log("creating client command: %s %s", d.pgclient, args)
-	return exec.Command("mlab", args...)
 }
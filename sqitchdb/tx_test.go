@@ -0,0 +1,31 @@
+package sqitchdb
+
+import "testing"
+
+func TestWithTx(t *testing.T) {
+	db, _ := New(t, "scheme", "", nil)
+	defer db.Close()
+
+	t.Run("isolated", func(t *testing.T) {
+		conn := db.WithTx(t)
+		if _, err := conn.Exec("INSERT INTO table1 DEFAULT VALUES"); err != nil {
+			t.Fatal("Failed inserting row:", err)
+		}
+	})
+
+	// the insert from the subtest above must not be visible here: WithTx
+	// rolled it back when the subtest finished
+	columns, err := getColumns(db.Conn(), "table1")
+	if err != nil {
+		t.Fatal("Error getting columns of table1:", err)
+	}
+	t.Logf("table1 has columns: %s", columns)
+
+	var count int
+	if err := db.Conn().QueryRow("SELECT count(*) FROM table1").Scan(&count); err != nil {
+		t.Fatal("Failed counting rows:", err)
+	}
+	if count != 0 {
+		t.Errorf("expected WithTx insert to be rolled back, found %d rows", count)
+	}
+}